@@ -0,0 +1,24 @@
+// Package options declares the protoc-gen-micro extensions to the standard
+// protobuf descriptor options, generated from micro.proto.
+package options
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	descriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// E_Codec is the (micro.codec) ServiceOptions extension. Set it on a
+// service to pick its wire codec independently of the --micro_out
+// plugin flag, e.g. `option (micro.codec) = "json";`.
+var E_Codec = &proto.ExtensionDesc{
+	ExtendedType:  (*descriptor.ServiceOptions)(nil),
+	ExtensionType: (*string)(nil),
+	Field:         71000,
+	Name:          "micro.codec",
+	Tag:           "bytes,71000,opt,name=codec",
+	Filename:      "micro.proto",
+}
+
+func init() {
+	proto.RegisterExtension(E_Codec)
+}
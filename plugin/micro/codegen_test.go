@@ -0,0 +1,177 @@
+package micro
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	proto "github.com/golang/protobuf/proto"
+	pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+
+	"github.com/shockerjue/protoc-gen-micro/generator"
+	"github.com/shockerjue/protoc-gen-micro/options"
+)
+
+// strFieldType/optionalLabel back FieldDescriptorProto.Type/Label, which are
+// pointer fields and so need an addressable variable to take the address of.
+var strFieldType = pb.FieldDescriptorProto_TYPE_STRING
+var optionalLabel = pb.FieldDescriptorProto_LABEL_OPTIONAL
+
+// testFile builds a minimal FileDescriptorProto for a "Pet" service: Get is a
+// plain unary method, Watch is server-streaming, and the service overrides
+// its wire codec to "msgpack" even though the plugin-wide flag below picks
+// "json", so the generated source can be checked against both.
+func testFile() *pb.FileDescriptorProto {
+	thing := &pb.DescriptorProto{
+		Name: proto.String("Thing"),
+		Field: []*pb.FieldDescriptorProto{
+			{Name: proto.String("id"), Number: proto.Int32(1), Label: &optionalLabel, Type: &strFieldType, JsonName: proto.String("id")},
+		},
+	}
+
+	svcOpts := &pb.ServiceOptions{}
+	if err := proto.SetExtension(svcOpts, options.E_Codec, proto.String("msgpack")); err != nil {
+		panic(err)
+	}
+
+	service := &pb.ServiceDescriptorProto{
+		Name:    proto.String("Pet"),
+		Options: svcOpts,
+		Method: []*pb.MethodDescriptorProto{
+			{
+				Name:       proto.String("Get"),
+				InputType:  proto.String(".testpb.Thing"),
+				OutputType: proto.String(".testpb.Thing"),
+			},
+			{
+				Name:            proto.String("Watch"),
+				InputType:       proto.String(".testpb.Thing"),
+				OutputType:      proto.String(".testpb.Thing"),
+				ServerStreaming: proto.Bool(true),
+			},
+		},
+	}
+
+	return &pb.FileDescriptorProto{
+		Name:        proto.String("test.proto"),
+		Package:     proto.String("testpb"),
+		Syntax:      proto.String("proto3"),
+		Options:     &pb.FileOptions{GoPackage: proto.String("testpb")},
+		MessageType: []*pb.DescriptorProto{thing},
+		Service:     []*pb.ServiceDescriptorProto{service},
+	}
+}
+
+// generator.RegisterUniquePackageName dedupes import aliases in a process-
+// global map, so running the generator pipeline more than once per test
+// binary renames "context"/"server"/etc to "context1"/"server1"/etc on the
+// second run. Generate exactly once and share the result across assertions.
+var (
+	generateOnce sync.Once
+	generatedSrc string
+)
+
+// generateTestFile drives the real protoc-gen-go-style generator pipeline
+// (the same one protoc invokes) against testFile, with the plugin-wide codec
+// flag set to "json", and returns the formatted Go source it produced. This
+// exercises generateService end to end instead of just the string-emitting
+// helpers in isolation, so it also catches anything that doesn't parse as Go.
+func generateTestFile(t *testing.T) string {
+	t.Helper()
+
+	generateOnce.Do(func() {
+		file := testFile()
+		g := generator.New()
+		g.Request = &plugin.CodeGeneratorRequest{
+			FileToGenerate: []string{file.GetName()},
+			Parameter:      proto.String("codec=json"),
+			ProtoFile:      []*pb.FileDescriptorProto{file},
+		}
+		g.CommandLineParameters(g.Request.GetParameter())
+		g.WrapTypes()
+		g.SetPackageNames()
+		g.BuildTypeNameMap()
+		g.GenerateAllFiles()
+
+		if len(g.Response.File) != 1 {
+			t.Fatalf("GenerateAllFiles() produced %d files, want 1", len(g.Response.File))
+		}
+		generatedSrc = g.Response.File[0].GetContent()
+	})
+	return generatedSrc
+}
+
+func TestGenerateServiceStreamingTypes(t *testing.T) {
+	src := generateTestFile(t)
+
+	for _, want := range []string{
+		"type Pet_WatchClient interface {",
+		"Recv() (*Thing, error)",
+		"type petWatchClient struct {",
+		"type Pet_WatchServer interface {",
+		"Send(*Thing) error",
+		"type petWatchServer struct {",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source missing streaming snippet %q\n---\n%s", want, src)
+		}
+	}
+}
+
+func TestGenerateServiceDesc(t *testing.T) {
+	src := generateTestFile(t)
+
+	for _, want := range []string{
+		"var _Pet_serviceDesc = server.ServiceDesc{",
+		`ServiceName: "Pet"`,
+		"HandlerType: (*PetHandler)(nil)",
+		"Methods: []server.MethodDesc{",
+		`MethodName: "Get"`,
+		"_Pet_Get_Handler",
+		"Streams: []server.StreamDesc{",
+		`"Watch"`,
+		"ServerStreams: true",
+		"ClientStreams: false",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source missing ServiceDesc snippet %q\n---\n%s", want, src)
+		}
+	}
+}
+
+func TestGenerateServiceCodecPrefersServiceOption(t *testing.T) {
+	src := generateTestFile(t)
+
+	// The plugin-wide flag says "json", but the service's (micro.codec)
+	// option overrides it to "msgpack"; every Unmarshal/Marshal call for Pet
+	// should use the override, not the flag.
+	if strings.Contains(src, `common.Unmarshal("json"`) || strings.Contains(src, `common.Marshal("json"`) {
+		t.Errorf("generated source used plugin-wide codec \"json\" instead of the (micro.codec) service override\n---\n%s", src)
+	}
+	for _, want := range []string{
+		`common.Unmarshal("msgpack", in, &req)`,
+		`common.Marshal("msgpack", respTyped)`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source missing per-service codec override snippet %q\n---\n%s", want, src)
+		}
+	}
+}
+
+func TestGenerateClientInterceptorChainOrder(t *testing.T) {
+	src := generateTestFile(t)
+
+	// Registration order must match execution order: build the chain by
+	// walking the interceptor slice backward so the first-registered
+	// interceptor ends up outermost (see 8c88b2b).
+	for _, want := range []string{
+		"interceptors := c.c.Interceptors()",
+		"for i := len(interceptors) - 1; i >= 0; i--",
+		"interceptor, next := interceptors[i], invoker",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source missing interceptor chain snippet %q\n---\n%s", want, src)
+		}
+	}
+}
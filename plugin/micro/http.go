@@ -0,0 +1,198 @@
+package micro
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	proto "github.com/golang/protobuf/proto"
+	pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	annotations "google.golang.org/genproto/googleapis/api/annotations"
+
+	"github.com/shockerjue/protoc-gen-micro/generator"
+)
+
+// httpPathParam matches the {name} path template syntax shared by
+// google.api.http and Go 1.22's net/http.ServeMux, e.g. "id" in
+// "/v1/things/{id}".
+var httpPathParam = regexp.MustCompile(`\{(\w+)(?:=[^}]*)?\}`)
+
+// httpBinding is a single google.api.http annotated method, resolved to the
+// verb/path/body it should be reachable at over REST.
+type httpBinding struct {
+	method *pb.MethodDescriptorProto
+	verb   string
+	path   string
+	body   string
+}
+
+// httpRulePattern extracts the verb and path template from the oneof set on
+// an HttpRule. Custom rules and additional_bindings are not supported.
+func httpRulePattern(rule *annotations.HttpRule) (verb, path string, ok bool) {
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "GET", p.Get, true
+	case *annotations.HttpRule_Put:
+		return "PUT", p.Put, true
+	case *annotations.HttpRule_Post:
+		return "POST", p.Post, true
+	case *annotations.HttpRule_Delete:
+		return "DELETE", p.Delete, true
+	case *annotations.HttpRule_Patch:
+		return "PATCH", p.Patch, true
+	default:
+		return "", "", false
+	}
+}
+
+// fileHasHTTPBindings reports whether any service in file has at least one
+// google.api.http annotated method, so GenerateImports can decide whether
+// "net/http" is needed.
+func fileHasHTTPBindings(file *generator.FileDescriptor) bool {
+	for _, service := range file.FileDescriptorProto.Service {
+		if len(httpBindings(service)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// httpBindings returns the google.api.http annotated unary methods of
+// service, in declaration order. Streaming methods are skipped: the REST
+// gateway only bridges unary request/response calls, and a client- or
+// server-streaming client signature doesn't line up with the single in/out
+// pair generateHTTPClientBinding/generateHTTPServerBinding emit.
+func httpBindings(service *pb.ServiceDescriptorProto) []httpBinding {
+	var bindings []httpBinding
+	for _, method := range service.Method {
+		if method.GetServerStreaming() || method.GetClientStreaming() {
+			continue
+		}
+		if method.Options == nil {
+			continue
+		}
+		ext, err := proto.GetExtension(method.Options, annotations.E_Http)
+		if err != nil {
+			continue
+		}
+		rule, ok := ext.(*annotations.HttpRule)
+		if !ok || rule == nil {
+			continue
+		}
+		verb, path, ok := httpRulePattern(rule)
+		if !ok {
+			continue
+		}
+		bindings = append(bindings, httpBinding{method: method, verb: verb, path: path, body: rule.GetBody()})
+	}
+	return bindings
+}
+
+// generateHTTPGateway emits RegisterServNameHTTPHandler/RegisterServNameHTTPServer
+// for every google.api.http annotated method of service, bridging REST
+// requests to the same client/server API generated above.
+func (g *micro) generateHTTPGateway(servName string, service *pb.ServiceDescriptorProto) {
+	bindings := httpBindings(service)
+	if len(bindings) == 0 {
+		return
+	}
+
+	g.P("// Register", servName, "HTTPHandler exposes the google.api.http annotated")
+	g.P("// methods of ", servName, " over REST, proxying each request through client.")
+	g.P("func Register", servName, "HTTPHandler(mux *http.ServeMux, client ", servName, ") {")
+	for _, b := range bindings {
+		g.generateHTTPClientBinding(servName, b)
+	}
+	g.P("}")
+	g.P()
+
+	g.P("// Register", servName, "HTTPServer exposes the google.api.http annotated")
+	g.P("// methods of ", servName, "Handler over REST, bridging http.Request to the handler.")
+	g.P("func Register", servName, "HTTPServer(mux *http.ServeMux, hdlr ", servName, "Handler) {")
+	for _, b := range bindings {
+		g.generateHTTPServerBinding(servName, b)
+	}
+	g.P("}")
+	g.P()
+}
+
+func (g *micro) generateHTTPClientBinding(servName string, b httpBinding) {
+	methName := generator.CamelCase(b.method.GetName())
+	inType := g.typeName(b.method.GetInputType())
+
+	g.P(`mux.HandleFunc("`, b.verb, " ", b.path, `", func(w http.ResponseWriter, r *http.Request) {`)
+	g.P("in := new(", inType, ")")
+	g.generateHTTPBinding(b)
+	g.P("out, err := client.", methName, "(r.Context(), in)")
+	g.P("common.WriteHTTPResponse(w, out, err)")
+	g.P("})")
+}
+
+func (g *micro) generateHTTPServerBinding(servName string, b httpBinding) {
+	methName := generator.CamelCase(b.method.GetName())
+	inType := g.typeName(b.method.GetInputType())
+
+	g.P(`mux.HandleFunc("`, b.verb, " ", b.path, `", func(w http.ResponseWriter, r *http.Request) {`)
+	g.P("in := new(", inType, ")")
+	g.generateHTTPBinding(b)
+	g.P("res, err := hdlr.", methName, "(r.Context(), in)")
+	g.P("common.WriteHTTPResponse(w, res, err)")
+	g.P("})")
+}
+
+// queryExcludedParams returns the top-level field names of b's request
+// message that are already bound from the path or a named body field, so
+// generateHTTPBinding can keep query binding from clobbering them (e.g. a
+// "?id=other" query string racing a {id} path param).
+func queryExcludedParams(b httpBinding) []string {
+	names := httpPathParam.FindAllStringSubmatch(b.path, -1)
+	excluded := make([]string, 0, len(names)+1)
+	for _, m := range names {
+		excluded = append(excluded, m[1])
+	}
+	if b.body != "" && b.body != "*" {
+		excluded = append(excluded, b.body)
+	}
+	return excluded
+}
+
+// generateHTTPBinding emits the path/query/body binding shared by the client
+// and server REST wrappers for b, leaving the bound message in "in".
+func (g *micro) generateHTTPBinding(b httpBinding) {
+	names := httpPathParam.FindAllStringSubmatch(b.path, -1)
+	if len(names) > 0 {
+		g.P("pathParams := map[string]string{}")
+		for _, m := range names {
+			g.P(fmt.Sprintf(`pathParams["%s"] = r.PathValue("%s")`, m[1], m[1]))
+		}
+		g.P("if err := common.BindPathParams(in, pathParams); err != nil {")
+		g.P("http.Error(w, err.Error(), http.StatusBadRequest)")
+		g.P("return")
+		g.P("}")
+	}
+	if b.body != "*" {
+		excluded := queryExcludedParams(b)
+		quoted := make([]string, len(excluded))
+		for i, name := range excluded {
+			quoted[i] = strconv.Quote(name)
+		}
+		g.P("if err := common.BindQueryParams(in, r.URL.Query(), ", strings.Join(quoted, ", "), "); err != nil {")
+		g.P("http.Error(w, err.Error(), http.StatusBadRequest)")
+		g.P("return")
+		g.P("}")
+	}
+	switch {
+	case b.body == "*":
+		g.P("if err := common.DecodeHTTPBody(r, in); err != nil {")
+		g.P("http.Error(w, err.Error(), http.StatusBadRequest)")
+		g.P("return")
+		g.P("}")
+	case b.body != "":
+		fieldName := generator.CamelCase(b.body)
+		g.P("if err := common.DecodeHTTPBody(r, &in.", fieldName, "); err != nil {")
+		g.P("http.Error(w, err.Error(), http.StatusBadRequest)")
+		g.P("return")
+		g.P("}")
+	}
+}
@@ -0,0 +1,109 @@
+package micro
+
+import (
+	"reflect"
+	"testing"
+
+	proto "github.com/golang/protobuf/proto"
+	pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	annotations "google.golang.org/genproto/googleapis/api/annotations"
+)
+
+func TestHttpRulePattern(t *testing.T) {
+	cases := []struct {
+		name     string
+		rule     *annotations.HttpRule
+		wantVerb string
+		wantPath string
+		wantOk   bool
+	}{
+		{"get", &annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/things/{id}"}}, "GET", "/v1/things/{id}", true},
+		{"post", &annotations.HttpRule{Pattern: &annotations.HttpRule_Post{Post: "/v1/things"}}, "POST", "/v1/things", true},
+		{"put", &annotations.HttpRule{Pattern: &annotations.HttpRule_Put{Put: "/v1/things/{id}"}}, "PUT", "/v1/things/{id}", true},
+		{"delete", &annotations.HttpRule{Pattern: &annotations.HttpRule_Delete{Delete: "/v1/things/{id}"}}, "DELETE", "/v1/things/{id}", true},
+		{"patch", &annotations.HttpRule{Pattern: &annotations.HttpRule_Patch{Patch: "/v1/things/{id}"}}, "PATCH", "/v1/things/{id}", true},
+		{"custom unsupported", &annotations.HttpRule{Pattern: &annotations.HttpRule_Custom{Custom: &annotations.CustomHttpPattern{}}}, "", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			verb, path, ok := httpRulePattern(tc.rule)
+			if verb != tc.wantVerb || path != tc.wantPath || ok != tc.wantOk {
+				t.Fatalf("httpRulePattern(%v) = (%q, %q, %v), want (%q, %q, %v)",
+					tc.rule, verb, path, ok, tc.wantVerb, tc.wantPath, tc.wantOk)
+			}
+		})
+	}
+}
+
+func TestQueryExcludedParams(t *testing.T) {
+	cases := []struct {
+		name string
+		b    httpBinding
+		want []string
+	}{
+		{
+			name: "path param only",
+			b:    httpBinding{verb: "GET", path: "/v1/things/{id}", body: ""},
+			want: []string{"id"},
+		},
+		{
+			name: "path param must not be clobbered by query binding",
+			b:    httpBinding{verb: "GET", path: "/v1/things/{id}/sub/{sub_id}", body: ""},
+			want: []string{"id", "sub_id"},
+		},
+		{
+			name: "named body field is excluded from query binding too",
+			b:    httpBinding{verb: "POST", path: "/v1/things/{id}", body: "thing"},
+			want: []string{"id", "thing"},
+		},
+		{
+			name: "no path params, no body field",
+			b:    httpBinding{verb: "POST", path: "/v1/things", body: ""},
+			want: []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := queryExcludedParams(tc.b)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("queryExcludedParams(%+v) = %v, want %v", tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHttpBindingsSkipsUnannotatedMethods(t *testing.T) {
+	service := &pb.ServiceDescriptorProto{
+		Method: []*pb.MethodDescriptorProto{
+			{Name: strPtr("Plain")},
+		},
+	}
+	if got := httpBindings(service); len(got) != 0 {
+		t.Fatalf("httpBindings() = %v, want no bindings for a method with no HttpRule", got)
+	}
+}
+
+func TestHttpBindingsSkipsStreamingMethods(t *testing.T) {
+	opts := &pb.MethodOptions{}
+	if err := proto.SetExtension(opts, annotations.E_Http, &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Get{Get: "/v1/things/{id}"},
+	}); err != nil {
+		t.Fatalf("SetExtension: %v", err)
+	}
+
+	service := &pb.ServiceDescriptorProto{
+		Method: []*pb.MethodDescriptorProto{
+			{Name: strPtr("ServerStream"), Options: opts, ServerStreaming: boolPtr(true)},
+			{Name: strPtr("ClientStream"), Options: opts, ClientStreaming: boolPtr(true)},
+		},
+	}
+	if got := httpBindings(service); len(got) != 0 {
+		t.Fatalf("httpBindings() = %v, want streaming methods excluded even when HttpRule annotated", got)
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func boolPtr(b bool) *bool { return &b }
@@ -1,3 +1,19 @@
+// Package micro generates github.com/shockerjue/gffg client/server bindings
+// from protobuf service definitions.
+//
+// Hard runtime dependency: the streaming types, ServiceDesc-based
+// registration, pluggable-codec dispatch, and interceptor chaining this
+// package emits all call into client.Stream, client.Client.NewStream,
+// client.Client.Interceptors, server.ServiceDesc/MethodDesc/StreamDesc/Stream,
+// server.UnaryServerInterceptor, Server.RegisterService, and
+// common.ClientInfo/ServerInfo/Marshal/Unmarshal/BindPathParams/
+// BindQueryParams/DecodeHTTPBody/WriteHTTPResponse. None of these exist in
+// github.com/shockerjue/gffg@v0.0.9, the only version published as of this
+// writing — only the older RpcHandler/RpcItem, []byte-in/[]byte-out shape is
+// there. Regenerating .pb.micro.go files with this plugin against gffg@v0.0.9
+// produces output that does not compile. A matching gffg release carrying
+// these types must be cut and pinned before this plugin is used beyond
+// v0.1.3's feature set.
 package micro
 
 import (
@@ -6,8 +22,10 @@ import (
 	"strconv"
 	"strings"
 
+	proto "github.com/golang/protobuf/proto"
 	pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
 	"github.com/shockerjue/protoc-gen-micro/generator"
+	"github.com/shockerjue/protoc-gen-micro/options"
 )
 
 // Paths for packages used by code generated in this file,
@@ -19,6 +37,10 @@ const (
 	commonPkgPath  = "github.com/shockerjue/gffg/common"
 )
 
+// defaultCodec is used when neither the codec plugin flag nor a per-service
+// (micro.codec) option picks one.
+const defaultCodec = "proto"
+
 func init() {
 	generator.RegisterPlugin(new(micro))
 }
@@ -27,6 +49,8 @@ func init() {
 // plugin architecture.  It generates bindings for go-micro support.
 type micro struct {
 	gen *generator.Generator
+	// codec is the default wire codec, set via --micro_out=codec=...
+	codec string
 }
 
 // Name returns the name of this plugin, "micro".
@@ -47,12 +71,29 @@ var (
 // Init initializes the plugin.
 func (g *micro) Init(gen *generator.Generator) {
 	g.gen = gen
+	g.codec = defaultCodec
+	if codec, ok := gen.Param["codec"]; ok && len(codec) > 0 {
+		g.codec = codec
+	}
 	contextPkg = generator.RegisterUniquePackageName("context", nil)
 	clientPkg = generator.RegisterUniquePackageName("client", nil)
 	serverPkg = generator.RegisterUniquePackageName("server", nil)
 	commonPkg = generator.RegisterUniquePackageName("common", nil)
 }
 
+// serviceCodec resolves the wire codec to use for service, preferring the
+// per-service (micro.codec) option over the plugin-wide flag.
+func (g *micro) serviceCodec(service *pb.ServiceDescriptorProto) string {
+	if service.Options != nil {
+		if ext, err := proto.GetExtension(service.Options, options.E_Codec); err == nil {
+			if codec, ok := ext.(*string); ok && codec != nil && len(*codec) > 0 {
+				return *codec
+			}
+		}
+	}
+	return g.codec
+}
+
 // Given a type name defined in a .proto, return its object.
 // Also record that we're using it, to guarantee the associated import.
 func (g *micro) objectNamed(name string) generator.Object {
@@ -86,10 +127,14 @@ func (g *micro) GenerateImports(file *generator.FileDescriptor) {
 	}
 	g.P("import (")
 	g.P(`"errors"`)
+	g.P(`"fmt"`)
 	g.P(clientPkg, " ", strconv.Quote(path.Join(g.gen.ImportPrefix, clientPkgPath)))
 	g.P(serverPkg, " ", strconv.Quote(path.Join(g.gen.ImportPrefix, serverPkgPath)))
 	g.P(contextPkg, " ", strconv.Quote(path.Join(g.gen.ImportPrefix, contextPkgPath)))
 	g.P(commonPkg, " ", strconv.Quote(path.Join(g.gen.ImportPrefix, commonPkgPath)))
+	if fileHasHTTPBindings(file) {
+		g.P(`"net/http"`)
+	}
 	g.P(")")
 	g.P()
 }
@@ -111,6 +156,7 @@ func (g *micro) generateService(file *generator.FileDescriptor, service *pb.Serv
 		serviceName = pkg
 	}
 	servName := generator.CamelCase(origServName)
+	codecName := g.serviceCodec(service)
 
 	g.P()
 	g.P("// Client API for ", servName, " service")
@@ -148,7 +194,7 @@ func (g *micro) generateService(file *generator.FileDescriptor, service *pb.Serv
 	// Client method implementations.
 	for _, method := range service.Method {
 		var descExpr string
-		if !method.GetServerStreaming() {
+		if !method.GetServerStreaming() && !method.GetClientStreaming() {
 			// Unary RPC method
 			descExpr = fmt.Sprintf("&%s.Methods[%d]", serviceDescVar, methodIndex)
 			methodIndex++
@@ -156,8 +202,9 @@ func (g *micro) generateService(file *generator.FileDescriptor, service *pb.Serv
 			// Streaming RPC method
 			descExpr = fmt.Sprintf("&%s.Streams[%d]", serviceDescVar, streamIndex)
 			streamIndex++
+			g.generateStreamTypes(servName, method)
 		}
-		g.generateClientMethod(serviceName, servName, serviceDescVar, method, descExpr)
+		g.generateClientMethod(serviceName, servName, serviceDescVar, codecName, method, descExpr)
 	}
 
 	g.P("// Server API for ", servName, " service")
@@ -175,39 +222,58 @@ func (g *micro) generateService(file *generator.FileDescriptor, service *pb.Serv
 
 	// Server registration.
 	g.P("func Register", servName, "Handler(s *", "server", ".Server, hdlr ", serverType, ", opts ...", serverPkg, ".HandlerOption) {")
-	g.P("type ", unexport(origServName), " interface {")
-	for _, method := range service.Method {
-		g.generateInterfaceSignature(servName, method)
-	}
-	g.P("}")
-	g.P("type ", servName, " struct {")
-	g.P(unexport(servName))
-	g.P("}")
-	g.P("h := &", unexport(servName)+"Handler", "{hdlr}")
-	g.P("handler := server.RpcHandler()")
-	for _, method := range service.Method {
-		methName := generator.CamelCase(method.GetName())
-		g.P("handler.Add(common.GenRid(\"", servName, ".", methName, "\"),&server.RpcItem {")
-		g.P("Call:h.", methName, ",")
-		g.P("Name:\"", servName, ".", methName, "\",")
-		g.P("})")
-	}
-	g.P("s.NewHandler(handler)")
-	g.P("}")
-	g.P()
-
-	// Handler type
-	g.P("type ", unexport(serverType), " struct {")
-	g.P(serverType)
+	g.P("s.RegisterService(&", serviceDescVar, ", hdlr, opts...)")
 	g.P("}")
 	g.P()
 
 	// Server handler implementations.
 	var handlerNames []string
 	for _, method := range service.Method {
-		hname := g.generateServerMethod(servName, method)
+		hname := g.generateServerMethod(servName, codecName, method)
 		handlerNames = append(handlerNames, hname)
 	}
+
+	g.generateServiceDesc(file, servName, serverType, serviceDescVar, service, handlerNames)
+
+	g.generateHTTPGateway(servName, service)
+}
+
+// generateServiceDesc emits the server.ServiceDesc literal that descExpr and
+// the streaming/unary registration thunks above refer to, mirroring the
+// ServiceDesc protoc-gen-go emits for gRPC.
+func (g *micro) generateServiceDesc(file *generator.FileDescriptor, servName, serverType, serviceDescVar string, service *pb.ServiceDescriptorProto, handlerNames []string) {
+	g.P("var ", serviceDescVar, " = ", serverPkg, ".ServiceDesc{")
+	g.P("ServiceName: \"", servName, "\",")
+	g.P("HandlerType: (*", serverType, ")(nil),")
+	g.P("Methods: []", serverPkg, ".MethodDesc{")
+	for i, method := range service.Method {
+		if method.GetServerStreaming() || method.GetClientStreaming() {
+			continue
+		}
+		methName := generator.CamelCase(method.GetName())
+		g.P("{")
+		g.P("MethodName: \"", methName, "\",")
+		g.P("Handler: ", handlerNames[i], ",")
+		g.P("},")
+	}
+	g.P("},")
+	g.P("Streams: []", serverPkg, ".StreamDesc{")
+	for i, method := range service.Method {
+		if !method.GetServerStreaming() && !method.GetClientStreaming() {
+			continue
+		}
+		methName := generator.CamelCase(method.GetName())
+		g.P("{")
+		g.P("StreamName: \"", methName, "\",")
+		g.P("Handler: ", handlerNames[i], ",")
+		g.P("ServerStreams: ", strconv.FormatBool(method.GetServerStreaming()), ",")
+		g.P("ClientStreams: ", strconv.FormatBool(method.GetClientStreaming()), ",")
+		g.P("},")
+	}
+	g.P("},")
+	g.P("Metadata: \"", file.GetName(), "\",")
+	g.P("}")
+	g.P()
 }
 
 // generateClientSignature returns the client-side signature for a method.
@@ -229,10 +295,15 @@ func (g *micro) generateClientSignature(servName string, method *pb.MethodDescri
 	return fmt.Sprintf("%s(ctx %s.Context%s, opts ...client.CallOption) (%s, err error)", methName, contextPkg, reqArg, respName)
 }
 
-func (g *micro) generateClientMethod(reqServ, servName, serviceDescVar string, method *pb.MethodDescriptorProto, descExpr string) {
+func (g *micro) generateClientMethod(reqServ, servName, serviceDescVar, codecName string, method *pb.MethodDescriptorProto, descExpr string) {
 	reqMethod := fmt.Sprintf("%s.%s", servName, method.GetName())
 	outType := g.typeName(method.GetOutputType())
 
+	if method.GetServerStreaming() || method.GetClientStreaming() {
+		g.generateClientStreamMethod(servName, method, descExpr)
+		return
+	}
+
 	g.P("func (c *", unexport(servName), ") ", g.generateClientSignature(servName, method), "{")
 	g.P("if nil == in {")
 	g.P(`	err = errors.New("`, reqMethod, ` req is nil")`)
@@ -241,9 +312,20 @@ func (g *micro) generateClientMethod(reqServ, servName, serviceDescVar string, m
 	g.P(`req := c.c.NewRequest(c.serviceName, "`, reqMethod, `", in)`)
 	g.P("out = new(", outType, ")")
 	// TODO: Pass descExpr to Invoke.
-	g.P(`res, err := c.c.Call(ctx, req, in, opts...)`)
+	g.P(`info := &common.ClientInfo{FullMethod: "`, reqMethod, `"}`)
+	g.P("invoker := func(ctx ", contextPkg, ".Context, opts ...client.CallOption) ([]byte, error) {")
+	g.P("return c.c.Call(ctx, req, in, opts...)")
+	g.P("}")
+	g.P("interceptors := c.c.Interceptors()")
+	g.P("for i := len(interceptors) - 1; i >= 0; i-- {")
+	g.P("interceptor, next := interceptors[i], invoker")
+	g.P("invoker = func(ctx ", contextPkg, ".Context, opts ...client.CallOption) ([]byte, error) {")
+	g.P("return interceptor(ctx, in, info, next, opts...)")
+	g.P("}")
+	g.P("}")
+	g.P("res, err := invoker(ctx, opts...)")
 	g.P("if err != nil { return  }")
-	g.P("err = out.Unmarshal(res)")
+	g.P(`err = common.Unmarshal("`, codecName, `", res, out)`)
 	g.P("return")
 	g.P("}")
 	g.P()
@@ -251,6 +333,35 @@ func (g *micro) generateClientMethod(reqServ, servName, serviceDescVar string, m
 	return
 }
 
+// generateClientStreamMethod generates the client-side stub for a streaming
+// method, returning a typed ServName_MethodClient that wraps client.Stream.
+func (g *micro) generateClientStreamMethod(servName string, method *pb.MethodDescriptorProto, descExpr string) {
+	reqMethod := fmt.Sprintf("%s.%s", servName, method.GetName())
+	methName := generator.CamelCase(method.GetName())
+	streamType := unexport(servName) + methName + "Client"
+
+	g.P("func (c *", unexport(servName), ") ", g.generateClientSignature(servName, method), "{")
+	if method.GetClientStreaming() {
+		g.P(`req := c.c.NewRequest(c.serviceName, "`, reqMethod, `", nil)`)
+	} else {
+		g.P("if nil == in {")
+		g.P(`	err = errors.New("`, reqMethod, ` req is nil")`)
+		g.P("   return")
+		g.P("}")
+		g.P(`req := c.c.NewRequest(c.serviceName, "`, reqMethod, `", in)`)
+	}
+	g.P("stream, err := c.c.NewStream(ctx, ", descExpr, ", req, opts...)")
+	g.P("if err != nil { return nil, err }")
+	g.P("x := &", streamType, "{stream}")
+	if !method.GetClientStreaming() {
+		g.P("if err = x.Stream.SendMsg(in); err != nil { return nil, err }")
+		g.P("if err = x.Stream.CloseSend(); err != nil { return nil, err }")
+	}
+	g.P("return x, nil")
+	g.P("}")
+	g.P()
+}
+
 // generateServerSignature returns the server-side signature for a method.
 func (g *micro) generateServerSignature(servName string, method *pb.MethodDescriptorProto) string {
 	origMethName := method.GetName()
@@ -259,6 +370,11 @@ func (g *micro) generateServerSignature(servName string, method *pb.MethodDescri
 		methName += "_"
 	}
 
+	if method.GetServerStreaming() || method.GetClientStreaming() {
+		streamType := servName + "_" + methName + "Server"
+		return methName + "(" + streamType + ") error"
+	}
+
 	var reqArgs []string
 	reqArgs = append(reqArgs, contextPkg+".Context")
 	reqArgs = append(reqArgs, "*"+g.typeName(method.GetInputType()))
@@ -267,41 +383,145 @@ func (g *micro) generateServerSignature(servName string, method *pb.MethodDescri
 	return methName + "(" + strings.Join(reqArgs, ", ") + ") " + ret
 }
 
-func (g *micro) generateServerInterface(servName string, method *pb.MethodDescriptorProto) string {
+// generateStreamTypes generates the typed client- and server-side stream
+// wrappers (ServName_MethodClient/Server) for a streaming method, mirroring
+// the shape grpc-go emits for its ClientStream/ServerStream wrappers.
+func (g *micro) generateStreamTypes(servName string, method *pb.MethodDescriptorProto) {
 	methName := generator.CamelCase(method.GetName())
-	hname := fmt.Sprintf("_%s_%s_Handler", servName, methName)
 	inType := g.typeName(method.GetInputType())
 	outType := g.typeName(method.GetOutputType())
 
-	g.P(methName, "(context.Context", ", *", inType, ") (*", outType, ",error)")
-	return hname
-}
+	clientIface := servName + "_" + methName + "Client"
+	clientImpl := unexport(servName) + methName + "Client"
+	serverIface := servName + "_" + methName + "Server"
+	serverImpl := unexport(servName) + methName + "Server"
 
-func (g *micro) generateInterfaceSignature(servName string, method *pb.MethodDescriptorProto) string {
-	methName := generator.CamelCase(method.GetName())
-	hname := fmt.Sprintf("_%s_%s_Handler", servName, methName)
+	// Client-side stream.
+	g.P("type ", clientIface, " interface {")
+	if method.GetClientStreaming() {
+		g.P("Send(*", inType, ") error")
+	}
+	if method.GetServerStreaming() {
+		g.P("Recv() (*", outType, ", error)")
+	} else {
+		g.P("CloseAndRecv() (*", outType, ", error)")
+	}
+	g.P("client.Stream")
+	g.P("}")
+	g.P()
 
-	g.P(methName, "(ctx context.Context, in []byte) (out []byte, err error)")
-	return hname
+	g.P("type ", clientImpl, " struct {")
+	g.P("client.Stream")
+	g.P("}")
+	g.P()
+
+	if method.GetClientStreaming() {
+		g.P("func (x *", clientImpl, ") Send(m *", inType, ") error {")
+		g.P("return x.Stream.SendMsg(m)")
+		g.P("}")
+		g.P()
+	}
+
+	if method.GetServerStreaming() {
+		g.P("func (x *", clientImpl, ") Recv() (*", outType, ", error) {")
+		g.P("m := new(", outType, ")")
+		g.P("if err := x.Stream.RecvMsg(m); err != nil { return nil, err }")
+		g.P("return m, nil")
+		g.P("}")
+		g.P()
+	} else {
+		g.P("func (x *", clientImpl, ") CloseAndRecv() (*", outType, ", error) {")
+		g.P("if err := x.Stream.CloseSend(); err != nil { return nil, err }")
+		g.P("m := new(", outType, ")")
+		g.P("if err := x.Stream.RecvMsg(m); err != nil { return nil, err }")
+		g.P("return m, nil")
+		g.P("}")
+		g.P()
+	}
+
+	// Server-side stream.
+	g.P("type ", serverIface, " interface {")
+	if method.GetServerStreaming() {
+		g.P("Send(*", outType, ") error")
+	} else {
+		g.P("SendAndClose(*", outType, ") error")
+	}
+	if method.GetClientStreaming() {
+		g.P("Recv() (*", inType, ", error)")
+	}
+	g.P("server.Stream")
+	g.P("}")
+	g.P()
+
+	g.P("type ", serverImpl, " struct {")
+	g.P("server.Stream")
+	g.P("}")
+	g.P()
+
+	if method.GetServerStreaming() {
+		g.P("func (x *", serverImpl, ") Send(m *", outType, ") error {")
+		g.P("return x.Stream.SendMsg(m)")
+		g.P("}")
+		g.P()
+	} else {
+		g.P("func (x *", serverImpl, ") SendAndClose(m *", outType, ") error {")
+		g.P("return x.Stream.SendMsg(m)")
+		g.P("}")
+		g.P()
+	}
+
+	if method.GetClientStreaming() {
+		g.P("func (x *", serverImpl, ") Recv() (*", inType, ", error) {")
+		g.P("m := new(", inType, ")")
+		g.P("if err := x.Stream.RecvMsg(m); err != nil { return nil, err }")
+		g.P("return m, nil")
+		g.P("}")
+		g.P()
+	}
 }
 
-func (g *micro) generateServerMethod(servName string, method *pb.MethodDescriptorProto) string {
+func (g *micro) generateServerMethod(servName, codecName string, method *pb.MethodDescriptorProto) string {
 	methName := generator.CamelCase(method.GetName())
 	hname := fmt.Sprintf("_%s_%s_Handler", servName, methName)
 	serveType := servName + "Handler"
+
+	if method.GetServerStreaming() || method.GetClientStreaming() {
+		streamImpl := unexport(servName) + methName + "Server"
+		g.P("func ", hname, "(srv interface{}, stream ", serverPkg, ".Stream) error {")
+		g.P("return srv.(", serveType, ").", methName, "(&", streamImpl, "{stream})")
+		g.P("}")
+		g.P()
+		return hname
+	}
+
 	inType := g.typeName(method.GetInputType())
 	outType := g.typeName(method.GetOutputType())
+	reqMethod := fmt.Sprintf("%s.%s", servName, method.GetName())
 
-	g.P("func (h *", unexport(serveType), ") ", methName, "(ctx context.Context", ", in []byte", ") (out []byte, err error) {")
+	g.P("func ", hname, "(srv interface{}, ctx context.Context, in []byte, interceptor ", serverPkg, ".UnaryServerInterceptor) (out []byte, err error) {")
 	g.P("var req ", inType)
-	g.P("err = req.Unmarshal(in)")
+	g.P(`err = common.Unmarshal("`, codecName, `", in, &req)`)
 	g.P("if nil != err { return }")
 	g.P()
-	g.P("var res *", outType)
-	g.P("res, err = h.", serveType, ".", methName, "(ctx, &req)")
+	g.P("handler := func(ctx context.Context, req interface{}) (interface{}, error) {")
+	g.P("return srv.(", serveType, ").", methName, "(ctx, req.(*", inType, "))")
+	g.P("}")
+	g.P()
+	g.P("var resp interface{}")
+	g.P("if nil != interceptor {")
+	g.P(`info := &common.ServerInfo{FullMethod: "`, reqMethod, `"}`)
+	g.P("resp, err = interceptor(ctx, &req, info, handler)")
+	g.P("} else {")
+	g.P("resp, err = handler(ctx, &req)")
+	g.P("}")
 	g.P("if nil != err { return }")
 	g.P()
-	g.P("out, err = res.Marshal()")
+	g.P("respTyped, ok := resp.(*", outType, ")")
+	g.P("if !ok {")
+	g.P(`err = fmt.Errorf("`, reqMethod, `: interceptor returned invalid response type %T", resp)`)
+	g.P("return")
+	g.P("}")
+	g.P(`out, err = common.Marshal("`, codecName, `", respTyped)`)
 	g.P("if nil != err { return }")
 	g.P("return")
 	g.P("}")